@@ -0,0 +1,288 @@
+// Default package
+package main
+
+//
+// Per-request auth: validates an inbound bearer/OIDC token and builds a
+// Kubernetes client scoped to that caller, so a shared deployment only
+// ever shows a viewer what their own RBAC permits.
+//
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/benc-uk/go-rest-api/pkg/env"
+	"github.com/coreos/go-oidc/v3/oidc"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// authCtxKey namespaces the values this middleware stashes in the request
+// context.
+type authCtxKey string
+
+const (
+	ctxKeyClient authCtxKey = "kubeview.client"
+	ctxKeyUser   authCtxKey = "kubeview.user"
+)
+
+// callerInfo is what we know about the authenticated caller, returned
+// verbatim (plus computed fields) by routeWhoAmI.
+type callerInfo struct {
+	Username string   `json:"username"`
+	Groups   []string `json:"groups"`
+}
+
+// clientFromContext returns the per-request Kubernetes client authMiddleware
+// attached to ctx, falling back to the package-level privileged clientset
+// when no middleware ran (e.g. OIDC isn't configured, so every caller
+// shares the server's own credentials - today's behaviour).
+func clientFromContext(ctx context.Context) kubernetes.Interface {
+	if c, ok := ctx.Value(ctxKeyClient).(kubernetes.Interface); ok && c != nil {
+		return c
+	}
+	return clientset
+}
+
+// callerFromContext returns the authenticated caller's identity, or the
+// zero value if the request wasn't authenticated (OIDC disabled).
+func callerFromContext(ctx context.Context) callerInfo {
+	if u, ok := ctx.Value(ctxKeyUser).(callerInfo); ok {
+		return u
+	}
+	return callerInfo{}
+}
+
+// isPrivilegedClient reports whether client is the server's own shared
+// clientset rather than a per-request impersonated one.
+func isPrivilegedClient(client kubernetes.Interface) bool {
+	return client == clientset
+}
+
+// oidcVerifierOnce and oidcVerifier back the lazily-constructed OIDC token
+// verifier, built from OIDC_ISSUER_URL (and optionally OIDC_CLIENT_ID as
+// the expected audience) the first time a request carries a token.
+var (
+	oidcVerifierOnce sync.Once
+	oidcVerifier     *oidc.IDTokenVerifier
+)
+
+func getOIDCVerifier() *oidc.IDTokenVerifier {
+	oidcVerifierOnce.Do(func() {
+		issuer := os.Getenv("OIDC_ISSUER_URL")
+		if issuer == "" {
+			return
+		}
+
+		provider, err := oidc.NewProvider(context.Background(), issuer)
+		if err != nil {
+			logger.Error("failed to initialise OIDC provider", "error", err.Error())
+			return
+		}
+
+		cfg := &oidc.Config{ClientID: os.Getenv("OIDC_CLIENT_ID")}
+		if cfg.ClientID == "" {
+			cfg.SkipClientIDCheck = true
+		}
+		oidcVerifier = provider.Verifier(cfg)
+	})
+	return oidcVerifier
+}
+
+// authTokenHeader is the header carrying the bearer/id token, configurable
+// so this works equally with a plain "Authorization: Bearer ..." or an
+// OIDC proxy's own id-token header.
+func authTokenHeader() string {
+	return env.GetEnvString("AUTH_TOKEN_HEADER", "Authorization")
+}
+
+// authMiddleware extracts a bearer/OIDC token from the request, validates
+// it against the configured issuer's JWKS, then builds a per-request
+// kubernetes.Interface as that caller and attaches it (and their identity)
+// to the request context. If OIDC_ISSUER_URL isn't set, or the request has
+// no token, it's a no-op - requests fall through to the shared
+// privileged clientset, preserving today's single-tenant behaviour.
+func authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		verifier := getOIDCVerifier()
+		if verifier == nil {
+			next.ServeHTTP(resp, req)
+			return
+		}
+
+		token := bearerToken(req.Header.Get(authTokenHeader()))
+		if token == "" {
+			next.ServeHTTP(resp, req)
+			return
+		}
+
+		idToken, err := verifier.Verify(req.Context(), token)
+		if err != nil {
+			http.Error(resp, "invalid token: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var claims struct {
+			Subject string   `json:"sub"`
+			Email   string   `json:"email"`
+			Groups  []string `json:"groups"`
+		}
+		if err := idToken.Claims(&claims); err != nil {
+			http.Error(resp, "invalid token claims: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		username := claims.Email
+		if username == "" {
+			username = claims.Subject
+		}
+
+		client, err := buildPerRequestClient(token, username, claims.Groups)
+		if err != nil {
+			logError(req.Context(), "failed to build per-request client", err)
+			http.Error(resp, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(req.Context(), ctxKeyClient, client)
+		ctx = context.WithValue(ctx, ctxKeyUser, callerInfo{Username: username, Groups: claims.Groups})
+		next.ServeHTTP(resp, req.WithContext(ctx))
+	})
+}
+
+// bearerToken strips a "Bearer " prefix if present, otherwise returns the
+// header value as-is (for a raw OIDC id-token header with no scheme).
+func bearerToken(header string) string {
+	const prefix = "Bearer "
+	if strings.HasPrefix(header, prefix) {
+		return strings.TrimPrefix(header, prefix)
+	}
+	return strings.TrimSpace(header)
+}
+
+// buildPerRequestClient builds a kubernetes.Interface for a single caller.
+// With IMPERSONATION_MODE=on the server keeps using its own (privileged)
+// credentials against the API server but asks it to impersonate the
+// caller, so every call is authorized as them. Otherwise the caller's own
+// bearer token is used directly, which requires the API server to trust
+// the same OIDC issuer.
+func buildPerRequestClient(token, username string, groups []string) (kubernetes.Interface, error) {
+	base, err := getBaseRESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("building base REST config: %w", err)
+	}
+	cfg := rest.CopyConfig(base)
+
+	if env.GetEnvString("IMPERSONATION_MODE", "off") == "on" {
+		cfg.Impersonate = rest.ImpersonationConfig{
+			UserName: username,
+			Groups:   groups,
+		}
+	} else {
+		cfg.BearerToken = token
+		cfg.BearerTokenFile = ""
+	}
+
+	return kubernetes.NewForConfig(cfg)
+}
+
+// Return the authenticated caller's identity plus every namespace in which
+// they can list pods.
+//
+// Deliberately one SelfSubjectAccessReview per namespace rather than a
+// single SelfSubjectRulesReview: a rules review only enumerates what the
+// caller's own namespace-scoped Roles/RoleBindings grant in whatever
+// namespace it's asked against, so getting "can list pods in ns" for every
+// namespace in the cluster still means one review per namespace either
+// way, and SSAR's answer also accounts for ClusterRoleBindings a rules
+// review can be reported as not fully resolving. The tradeoff is an
+// O(namespace-count) review burst on every /api/whoami call, acceptable
+// for the expected cluster sizes here but worth revisiting if this needs
+// to scale to clusters with thousands of namespaces.
+func routeWhoAmI(resp http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	caller := callerFromContext(ctx)
+	client := clientFromContext(ctx)
+
+	namespaces, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		logError(ctx, "kubernetes API error", err)
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	podNamespaces := make([]string, 0, len(namespaces.Items))
+	for _, ns := range namespaces.Items {
+		if canListPods(ctx, client, ns.Name) {
+			podNamespaces = append(podNamespaces, ns.Name)
+		}
+	}
+
+	type whoAmI struct {
+		callerInfo
+		PodNamespaces []string `json:"podNamespaces"`
+	}
+	body := whoAmI{callerInfo: caller, PodNamespaces: podNamespaces}
+
+	writeJSON(resp, body)
+}
+
+func canListPods(ctx context.Context, client kubernetes.Interface, namespace string) bool {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      "list",
+				Resource:  "pods",
+			},
+		},
+	}
+
+	result, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false
+	}
+	return result.Status.Allowed
+}
+
+// writeJSON marshals v and writes it with the usual CORS/content-type
+// headers every route here sets.
+func writeJSON(resp http.ResponseWriter, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("failed to marshal response", "error", err.Error())
+		http.Error(resp, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+	resp.Header().Add("Content-Type", "application/json")
+	if _, err := resp.Write(body); err != nil {
+		logger.Error("failed to write response body")
+	}
+}
+
+// baseRESTConfigOnce and baseRESTConfig back the server's own (privileged)
+// REST config, used as the template every per-request client is built from
+// - either by swapping in the caller's bearer token or by adding
+// Impersonate on top of it. Built lazily, the same way bootstrap.go builds
+// the in-cluster config the package-level clientset itself comes from.
+var (
+	baseRESTConfigOnce sync.Once
+	baseRESTConfig     *rest.Config
+	baseRESTConfigErr  error
+)
+
+func getBaseRESTConfig() (*rest.Config, error) {
+	baseRESTConfigOnce.Do(func() {
+		baseRESTConfig, baseRESTConfigErr = buildRESTConfig()
+	})
+	return baseRESTConfig, baseRESTConfigErr
+}
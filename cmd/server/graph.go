@@ -0,0 +1,453 @@
+// Default package
+package main
+
+//
+// Server-side graph construction: resolves owner references, service
+// selectors, ingress backends and volume mounts into a compact
+// {nodes, edges} shape so the frontend doesn't have to ship every raw
+// object to the browser and recompute the same relationships client-side.
+//
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// graphNode is the trimmed-down view of an object the graph exposes -
+// enough to render and label it, without the full spec/status payload.
+// Drill-down for the complete object goes through routeObject.
+type graphNode struct {
+	ID        string            `json:"id"`
+	Kind      string            `json:"kind"`
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Status    string            `json:"status,omitempty"`
+}
+
+// graphEdge connects two graphNode IDs. Type is one of "ownerRef",
+// "selects", "routes" or "mounts".
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+}
+
+type graphResult struct {
+	Nodes        []graphNode     `json:"nodes"`
+	Edges        []graphEdge     `json:"edges"`
+	Continue     string          `json:"continue,omitempty"`
+	AccessDenied map[string]bool `json:"accessDenied,omitempty"`
+}
+
+// nodeID is the cross-cutting key used for both graph node IDs and the
+// scraper package's Event keying: kind/namespace/name.
+func nodeID(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// graphListOptions builds a metav1.ListOptions from the query params every
+// List call in routeGraph is given, so a huge namespace can be paged
+// through instead of fetched (and rendered) all at once. limit/continue
+// apply per List call rather than across the whole graph - the API server
+// hands back a continue token that's only valid for the resource type it
+// was issued against, so we surface the Pod list's token as the
+// representative "next page" cursor, Pods being by far the dominant
+// resource in most namespaces.
+func graphListOptions(req *http.Request) metav1.ListOptions {
+	q := req.URL.Query()
+	opts := metav1.ListOptions{
+		Continue:      q.Get("continue"),
+		LabelSelector: q.Get("labelSelector"),
+	}
+	if limit, err := strconv.ParseInt(q.Get("limit"), 10, 64); err == nil && limit > 0 {
+		opts.Limit = limit
+	}
+	return opts
+}
+
+// Build a {nodes, edges} graph for namespace: owner references, service
+// selectors, ingress backends and pod volume mounts, resolved server-side
+// so the browser never has to hold or diff the raw objects.
+func routeGraph(resp http.ResponseWriter, req *http.Request) {
+	namespace := mux.Vars(req)["ns"]
+	ctx := req.Context()
+	client := clientFromContext(ctx)
+	allowed := checkAccess(ctx, client, namespace)
+	opts := graphListOptions(req)
+
+	result, err := buildGraph(ctx, client, namespace, allowed, opts)
+	if err != nil {
+		logError(ctx, "failed to build graph", err)
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(resp, result)
+}
+
+// otherKindListOptions derives the ListOptions every non-Pod kind is
+// listed with: same label selector and limit as the caller asked for, but
+// never opts.Continue. A continue token is only valid against the List
+// call (same resource type, same resourceVersion) that issued it, so
+// reusing the Pod list's token against e.g. Services would just get a 410
+// from the API server - each kind here is its own unbounded-but-limited
+// page instead of a participant in the caller's pagination sequence.
+func otherKindListOptions(opts metav1.ListOptions) metav1.ListOptions {
+	return metav1.ListOptions{LabelSelector: opts.LabelSelector, Limit: opts.Limit}
+}
+
+func buildGraph(ctx context.Context, client kubernetes.Interface, namespace string, allowed map[string]bool, opts metav1.ListOptions) (graphResult, error) {
+	result := graphResult{AccessDenied: deniedKinds(allowed)}
+	pageOpts := otherKindListOptions(opts)
+
+	var pods []apiv1.Pod
+	if kindAllowed(allowed, "Pod") {
+		v, err := client.CoreV1().Pods(namespace).List(ctx, opts)
+		if err != nil {
+			return graphResult{}, fmt.Errorf("listing pods: %w", err)
+		}
+		pods = v.Items
+		result.Continue = v.Continue
+	}
+
+	var services []apiv1.Service
+	if kindAllowed(allowed, "Service") {
+		v, err := client.CoreV1().Services(namespace).List(ctx, pageOpts)
+		if err != nil {
+			return graphResult{}, fmt.Errorf("listing services: %w", err)
+		}
+		services = v.Items
+	}
+
+	var configMaps []apiv1.ConfigMap
+	if kindAllowed(allowed, "ConfigMap") {
+		v, err := client.CoreV1().ConfigMaps(namespace).List(ctx, pageOpts)
+		if err != nil {
+			return graphResult{}, fmt.Errorf("listing configmaps: %w", err)
+		}
+		configMaps = v.Items
+	}
+
+	var secrets []apiv1.Secret
+	if kindAllowed(allowed, "Secret") {
+		v, err := client.CoreV1().Secrets(namespace).List(ctx, pageOpts)
+		if err != nil {
+			return graphResult{}, fmt.Errorf("listing secrets: %w", err)
+		}
+		secrets = v.Items
+	}
+
+	var pvcs []apiv1.PersistentVolumeClaim
+	if kindAllowed(allowed, "PersistentVolumeClaim") {
+		v, err := client.CoreV1().PersistentVolumeClaims(namespace).List(ctx, pageOpts)
+		if err != nil {
+			return graphResult{}, fmt.Errorf("listing persistentvolumeclaims: %w", err)
+		}
+		pvcs = v.Items
+	}
+
+	var deployments []appsv1.Deployment
+	if kindAllowed(allowed, "Deployment") {
+		v, err := client.AppsV1().Deployments(namespace).List(ctx, pageOpts)
+		if err != nil {
+			return graphResult{}, fmt.Errorf("listing deployments: %w", err)
+		}
+		deployments = v.Items
+	}
+
+	var daemonSets []appsv1.DaemonSet
+	if kindAllowed(allowed, "DaemonSet") {
+		v, err := client.AppsV1().DaemonSets(namespace).List(ctx, pageOpts)
+		if err != nil {
+			return graphResult{}, fmt.Errorf("listing daemonsets: %w", err)
+		}
+		daemonSets = v.Items
+	}
+
+	var replicaSets []appsv1.ReplicaSet
+	if kindAllowed(allowed, "ReplicaSet") {
+		v, err := client.AppsV1().ReplicaSets(namespace).List(ctx, pageOpts)
+		if err != nil {
+			return graphResult{}, fmt.Errorf("listing replicasets: %w", err)
+		}
+		replicaSets = v.Items
+	}
+
+	var statefulSets []appsv1.StatefulSet
+	if kindAllowed(allowed, "StatefulSet") {
+		v, err := client.AppsV1().StatefulSets(namespace).List(ctx, pageOpts)
+		if err != nil {
+			return graphResult{}, fmt.Errorf("listing statefulsets: %w", err)
+		}
+		statefulSets = v.Items
+	}
+
+	var ingresses []networkingv1.Ingress
+	if kindAllowed(allowed, "Ingress") {
+		v, err := client.NetworkingV1().Ingresses(namespace).List(ctx, pageOpts)
+		if err != nil {
+			return graphResult{}, fmt.Errorf("listing ingresses: %w", err)
+		}
+		ingresses = v.Items
+	}
+
+	for _, p := range pods {
+		result.Nodes = append(result.Nodes, graphNode{
+			ID: nodeID("Pod", p.Namespace, p.Name), Kind: "Pod", Name: p.Name,
+			Namespace: p.Namespace, Labels: p.Labels, Status: string(p.Status.Phase),
+		})
+		result.Edges = append(result.Edges, ownerRefEdges("Pod", p.Namespace, p.Name, p.OwnerReferences)...)
+		result.Edges = append(result.Edges, mountEdges("Pod", p.Namespace, p.Name, p.Spec.Volumes)...)
+	}
+
+	for _, s := range services {
+		result.Nodes = append(result.Nodes, graphNode{
+			ID: nodeID("Service", s.Namespace, s.Name), Kind: "Service", Name: s.Name,
+			Namespace: s.Namespace, Labels: s.Labels, Status: string(s.Spec.Type),
+		})
+		result.Edges = append(result.Edges, selectsEdges(s, pods)...)
+	}
+
+	for _, cm := range configMaps {
+		result.Nodes = append(result.Nodes, graphNode{
+			ID: nodeID("ConfigMap", cm.Namespace, cm.Name), Kind: "ConfigMap", Name: cm.Name,
+			Namespace: cm.Namespace, Labels: cm.Labels,
+		})
+	}
+
+	for _, sec := range secrets {
+		if isHelmReleaseSecret(sec) {
+			continue
+		}
+		result.Nodes = append(result.Nodes, graphNode{
+			ID: nodeID("Secret", sec.Namespace, sec.Name), Kind: "Secret", Name: sec.Name,
+			Namespace: sec.Namespace, Labels: sec.Labels, Status: string(sec.Type),
+		})
+	}
+
+	for _, pvc := range pvcs {
+		result.Nodes = append(result.Nodes, graphNode{
+			ID: nodeID("PersistentVolumeClaim", pvc.Namespace, pvc.Name), Kind: "PersistentVolumeClaim",
+			Name: pvc.Name, Namespace: pvc.Namespace, Labels: pvc.Labels, Status: string(pvc.Status.Phase),
+		})
+	}
+
+	for _, d := range deployments {
+		result.Nodes = append(result.Nodes, graphNode{
+			ID: nodeID("Deployment", d.Namespace, d.Name), Kind: "Deployment", Name: d.Name,
+			Namespace: d.Namespace, Labels: d.Labels,
+			Status: fmt.Sprintf("%d/%d", d.Status.ReadyReplicas, d.Status.Replicas),
+		})
+	}
+
+	for _, ds := range daemonSets {
+		result.Nodes = append(result.Nodes, graphNode{
+			ID: nodeID("DaemonSet", ds.Namespace, ds.Name), Kind: "DaemonSet", Name: ds.Name,
+			Namespace: ds.Namespace, Labels: ds.Labels,
+			Status: fmt.Sprintf("%d/%d", ds.Status.NumberReady, ds.Status.DesiredNumberScheduled),
+		})
+	}
+
+	for _, rs := range replicaSets {
+		result.Nodes = append(result.Nodes, graphNode{
+			ID: nodeID("ReplicaSet", rs.Namespace, rs.Name), Kind: "ReplicaSet", Name: rs.Name,
+			Namespace: rs.Namespace, Labels: rs.Labels,
+			Status: fmt.Sprintf("%d/%d", rs.Status.ReadyReplicas, rs.Status.Replicas),
+		})
+		result.Edges = append(result.Edges, ownerRefEdges("ReplicaSet", rs.Namespace, rs.Name, rs.OwnerReferences)...)
+	}
+
+	for _, ss := range statefulSets {
+		result.Nodes = append(result.Nodes, graphNode{
+			ID: nodeID("StatefulSet", ss.Namespace, ss.Name), Kind: "StatefulSet", Name: ss.Name,
+			Namespace: ss.Namespace, Labels: ss.Labels,
+			Status: fmt.Sprintf("%d/%d", ss.Status.ReadyReplicas, ss.Status.Replicas),
+		})
+	}
+
+	for _, ing := range ingresses {
+		result.Nodes = append(result.Nodes, graphNode{
+			ID: nodeID("Ingress", ing.Namespace, ing.Name), Kind: "Ingress", Name: ing.Name,
+			Namespace: ing.Namespace, Labels: ing.Labels,
+		})
+		result.Edges = append(result.Edges, routesEdges(ing)...)
+	}
+
+	return result, nil
+}
+
+// ownerRefEdges emits one "ownerRef" edge per controller/owner reference a
+// Pod or ReplicaSet carries, pointing from the owned object to its owner
+// (ReplicaSet/DaemonSet/StatefulSet, or ReplicaSet->Deployment).
+func ownerRefEdges(kind, namespace, name string, refs []metav1.OwnerReference) []graphEdge {
+	edges := make([]graphEdge, 0, len(refs))
+	for _, ref := range refs {
+		edges = append(edges, graphEdge{
+			From: nodeID(kind, namespace, name),
+			To:   nodeID(ref.Kind, namespace, ref.Name),
+			Type: "ownerRef",
+		})
+	}
+	return edges
+}
+
+// selectsEdges emits one "selects" edge per Pod whose labels match the
+// Service's selector. A Service with an empty selector (e.g. headless,
+// externalName) selects nothing.
+func selectsEdges(svc apiv1.Service, pods []apiv1.Pod) []graphEdge {
+	if len(svc.Spec.Selector) == 0 {
+		return nil
+	}
+	sel := labels.SelectorFromSet(svc.Spec.Selector)
+
+	var edges []graphEdge
+	for _, p := range pods {
+		if p.Namespace != svc.Namespace {
+			continue
+		}
+		if sel.Matches(labels.Set(p.Labels)) {
+			edges = append(edges, graphEdge{
+				From: nodeID("Service", svc.Namespace, svc.Name),
+				To:   nodeID("Pod", p.Namespace, p.Name),
+				Type: "selects",
+			})
+		}
+	}
+	return edges
+}
+
+// routesEdges emits one "routes" edge per distinct backend Service named
+// across an Ingress's rules.
+func routesEdges(ing networkingv1.Ingress) []graphEdge {
+	seen := map[string]bool{}
+	var edges []graphEdge
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Backend.Service == nil || seen[path.Backend.Service.Name] {
+				continue
+			}
+			seen[path.Backend.Service.Name] = true
+			edges = append(edges, graphEdge{
+				From: nodeID("Ingress", ing.Namespace, ing.Name),
+				To:   nodeID("Service", ing.Namespace, path.Backend.Service.Name),
+				Type: "routes",
+			})
+		}
+	}
+	return edges
+}
+
+// mountEdges emits one "mounts" edge per ConfigMap/Secret/PVC a Pod's
+// volumes reference.
+func mountEdges(kind, namespace, name string, volumes []apiv1.Volume) []graphEdge {
+	var edges []graphEdge
+	for _, vol := range volumes {
+		switch {
+		case vol.ConfigMap != nil:
+			edges = append(edges, graphEdge{From: nodeID(kind, namespace, name), To: nodeID("ConfigMap", namespace, vol.ConfigMap.Name), Type: "mounts"})
+		case vol.Secret != nil:
+			edges = append(edges, graphEdge{From: nodeID(kind, namespace, name), To: nodeID("Secret", namespace, vol.Secret.SecretName), Type: "mounts"})
+		case vol.PersistentVolumeClaim != nil:
+			edges = append(edges, graphEdge{From: nodeID(kind, namespace, name), To: nodeID("PersistentVolumeClaim", namespace, vol.PersistentVolumeClaim.ClaimName), Type: "mounts"})
+		}
+	}
+	return edges
+}
+
+// Return a single raw object for drill-down, since routeGraph strips
+// everything but id/kind/name/labels/status to keep the graph payload
+// small.
+func routeObject(resp http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	namespace, kind, name := params["ns"], params["kind"], params["name"]
+
+	ctx := req.Context()
+	client := clientFromContext(ctx)
+
+	obj, err := getObject(ctx, client, namespace, kind, name)
+	if errors.Is(err, errHelmSecretHidden) {
+		http.Error(resp, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logError(ctx, "failed to get object", err)
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if obj == nil {
+		http.Error(resp, "unknown kind: "+kind, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(resp, obj)
+}
+
+// errHelmSecretHidden is returned by getObject for a Helm v3 release
+// secret - routeScrapeData and routeGraph both hide these already, so
+// drill-down shouldn't be a backdoor to the same data.
+var errHelmSecretHidden = errors.New("not available for drill-down")
+
+// getObject fetches a single object of kind by name, matching the kinds
+// scrapeData/graphResult know about. Returns a nil object (not an error)
+// for a kind this endpoint doesn't recognise.
+func getObject(ctx context.Context, client kubernetes.Interface, namespace, kind, name string) (interface{}, error) {
+	getOpts := metav1.GetOptions{}
+	switch strings.ToLower(kind) {
+	case "pod":
+		return client.CoreV1().Pods(namespace).Get(ctx, name, getOpts)
+	case "service":
+		return client.CoreV1().Services(namespace).Get(ctx, name, getOpts)
+	case "endpoints":
+		return client.CoreV1().Endpoints(namespace).Get(ctx, name, getOpts)
+	case "persistentvolume":
+		return client.CoreV1().PersistentVolumes().Get(ctx, name, getOpts)
+	case "persistentvolumeclaim":
+		return client.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, getOpts)
+	case "configmap":
+		cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, getOpts)
+		if err != nil {
+			return nil, err
+		}
+		redactConfigMaps([]apiv1.ConfigMap{*cm})
+		return cm, nil
+	case "secret":
+		if isHelmReleaseSecret(apiv1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name}}) {
+			return nil, errHelmSecretHidden
+		}
+		secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, getOpts)
+		if err != nil {
+			return nil, err
+		}
+		redacted := redactSecrets([]apiv1.Secret{*secret})[0]
+		return &redacted, nil
+	case "deployment":
+		return client.AppsV1().Deployments(namespace).Get(ctx, name, getOpts)
+	case "daemonset":
+		return client.AppsV1().DaemonSets(namespace).Get(ctx, name, getOpts)
+	case "replicaset":
+		return client.AppsV1().ReplicaSets(namespace).Get(ctx, name, getOpts)
+	case "statefulset":
+		return client.AppsV1().StatefulSets(namespace).Get(ctx, name, getOpts)
+	case "ingress":
+		return client.NetworkingV1().Ingresses(namespace).Get(ctx, name, getOpts)
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,121 @@
+// Default package
+package main
+
+//
+// Structured JSON request logging and a request-id middleware, replacing
+// the old log.Println("### ...") convention this package used to use.
+//
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// logger is the process-wide structured logger, JSON to stdout so it's
+// easy to ship to whatever's aggregating logs.
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+type logCtxKey string
+
+const ctxKeyRequestID logCtxKey = "kubeview.requestID"
+
+// requestIDFromContext returns the id requestIDMiddleware assigned to this
+// request, or "" if the middleware didn't run (e.g. in a background task).
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeyRequestID).(string)
+	return id
+}
+
+// logError logs err against whatever request ctx belongs to, tagging it
+// with that request's id so a single slow or failing scrape can be traced
+// through the log in one grep.
+func logError(ctx context.Context, msg string, err error) {
+	logger.Error(msg, "request_id", requestIDFromContext(ctx), "error", err.Error())
+}
+
+// requestIDMiddleware assigns every request a short id (echoed back as the
+// X-Request-Id response header), then logs one structured line once the
+// handler returns: request id, remote addr, route, namespace (if the
+// route has one), status code and duration. It also drives the
+// kubeview_http_requests_total counter.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		id := newRequestID()
+		resp.Header().Set("X-Request-Id", id)
+		req = req.WithContext(context.WithValue(req.Context(), ctxKeyRequestID, id))
+
+		rec := &statusRecorder{ResponseWriter: resp, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(rec, req)
+
+		route := routeTemplate(req)
+		httpRequestsTotal.WithLabelValues(route, strconv.Itoa(rec.status)).Inc()
+
+		logger.Info("request",
+			"request_id", id,
+			"remote_addr", req.RemoteAddr,
+			"method", req.Method,
+			"route", route,
+			"namespace", mux.Vars(req)["ns"],
+			"status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
+
+// newRequestID returns a short random hex id for X-Request-Id.
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
+
+// statusRecorder captures the status code written so it can be logged and
+// counted after the handler returns.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack passes through to the underlying ResponseWriter's http.Hijacker,
+// so wrapping a connection in a statusRecorder doesn't break routeWatchData's
+// websocket upgrade - websocket.Upgrader.Upgrade requires the writer it's
+// given to support hijacking.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("underlying ResponseWriter does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// routeTemplate returns the matched route's path template (e.g.
+// "/api/scrape/{ns}") rather than the literal request path, so metrics and
+// logs aggregate sensibly across namespaces instead of fragmenting per ns.
+func routeTemplate(req *http.Request) string {
+	if route := mux.CurrentRoute(req); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return req.URL.Path
+}
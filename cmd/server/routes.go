@@ -9,22 +9,73 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"os"
-	"regexp"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/ECPaaS/cloudview-kubeview/pkg/redact"
+	"github.com/ECPaaS/cloudview-kubeview/pkg/scraper"
 	"github.com/benc-uk/go-rest-api/pkg/env"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 
 	appsv1 "k8s.io/api/apps/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	apiv1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
+// scraperOnce and dataScraper back the shared informer cache that
+// routeScrapeData and routeWatchData both read from. It's built lazily
+// against the package-level clientset the first time either route needs it.
+var (
+	scraperOnce sync.Once
+	dataScraper *scraper.Scraper
+)
+
+func getScraper() *scraper.Scraper {
+	scraperOnce.Do(func() {
+		dataScraper = scraper.New(clientset)
+		dataScraper.SetMetricsHook(func(namespace, kind string, d time.Duration, err error) {
+			observeScrape(namespace, kind, time.Now().Add(-d), err)
+		})
+	})
+	return dataScraper
+}
+
+// redactorOnce and redactor back the pluggable redaction rule registry,
+// loaded from REDACTION_CONFIG (if set) plus the built-in rules.
+var (
+	redactorOnce sync.Once
+	redactor     *redact.Registry
+)
+
+func getRedactor() *redact.Registry {
+	redactorOnce.Do(func() {
+		reg, err := redact.LoadFromEnv()
+		if err != nil {
+			logger.Error("failed to load redaction config, falling back to built-ins", "error", err.Error())
+		}
+		reg.OnFire(func(rule string) { redactionsTotal.WithLabelValues(rule).Inc() })
+		redactor = reg
+	})
+	return redactor
+}
+
+// watchUpgrader upgrades routeWatchData connections to WebSocket. Origin
+// checking is left to whatever's fronting this service (e.g. the API
+// gateway doing the OIDC/auth work), same as every other route here.
+var watchUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
 // Config is simple structure returned by routeConfig
 type Config struct {
 	NamespaceScope string
@@ -44,64 +95,196 @@ type scrapeData struct {
 	Ingresses              []networkingv1.Ingress        `json:"ingresses"`
 	ConfigMaps             []apiv1.ConfigMap             `json:"configmaps"`
 	Secrets                []apiv1.Secret                `json:"secrets"`
+	AccessDenied           map[string]bool               `json:"accessDenied,omitempty"`
+}
+
+// accessReviewResource maps a kind (as used by the scraper package and this
+// file's AccessDenied marker) to the API group/resource an RBAC rule is
+// actually written against.
+type accessReviewResource struct {
+	kind     string
+	group    string
+	resource string
+	// clusterScoped resources (currently just PersistentVolume) are
+	// reviewed without a namespace, since that's how their RBAC rules
+	// are written.
+	clusterScoped bool
 }
 
-// Redact any certificate data from the input byte slice
-func redactCertificates(data []byte) []byte {
-	certRegex := regexp.MustCompile(`(?i)-----+BEGIN\s+CERTIFICATE-----+[^\-]+-----+END\s+CERTIFICATE-----+`)
-	return certRegex.ReplaceAll(data, []byte("__CERTIFICATE REDACTED__"))
+var accessReviewResources = []accessReviewResource{
+	{kind: "Pod", resource: "pods"},
+	{kind: "Service", resource: "services"},
+	{kind: "Endpoints", resource: "endpoints"},
+	{kind: "PersistentVolume", resource: "persistentvolumes", clusterScoped: true},
+	{kind: "PersistentVolumeClaim", resource: "persistentvolumeclaims"},
+	{kind: "ConfigMap", resource: "configmaps"},
+	{kind: "Secret", resource: "secrets"},
+	{kind: "Deployment", group: "apps", resource: "deployments"},
+	{kind: "DaemonSet", group: "apps", resource: "daemonsets"},
+	{kind: "ReplicaSet", group: "apps", resource: "replicasets"},
+	{kind: "StatefulSet", group: "apps", resource: "statefulsets"},
+	{kind: "Ingress", group: "networking.k8s.io", resource: "ingresses"},
 }
 
-// Redact certificates from any JSON-like structure recursively
-func redactCertificatesInJSON(data interface{}) interface{} {
-	switch v := data.(type) {
-	case map[string]interface{}:
-		for key, val := range v {
-			v[key] = redactCertificatesInJSON(val)
+// checkAccess runs a SelfSubjectAccessReview for "list" against every
+// resource type routeScrapeData cares about, as client, so we know up
+// front what the caller can actually read instead of finding out by eating
+// a 403 from the first forbidden List call. A review that itself errors is
+// treated as denied - least-privilege by default.
+func checkAccess(ctx context.Context, client kubernetes.Interface, namespace string) map[string]bool {
+	allowed := make(map[string]bool, len(accessReviewResources))
+
+	for _, r := range accessReviewResources {
+		reviewNamespace := namespace
+		if r.clusterScoped {
+			reviewNamespace = ""
 		}
-		return v
-	case []interface{}:
-		for i, val := range v {
-			v[i] = redactCertificatesInJSON(val)
+
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: reviewNamespace,
+					Verb:      "list",
+					Group:     r.group,
+					Resource:  r.resource,
+				},
+			},
+		}
+
+		result, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			logger.Error("SelfSubjectAccessReview failed", "resource", r.resource, "error", err.Error())
+			allowed[r.kind] = false
+			continue
+		}
+		allowed[r.kind] = result.Status.Allowed
+	}
+
+	return allowed
+}
+
+// deniedKinds picks out the kinds checkAccess marked as not allowed, in the
+// shape scrapeData.AccessDenied expects.
+func deniedKinds(allowed map[string]bool) map[string]bool {
+	denied := make(map[string]bool)
+	for kind, ok := range allowed {
+		if !ok {
+			denied[kind] = true
 		}
-		return v
-	case string:
-		return string(redactCertificates([]byte(v)))
-	default:
-		return data
 	}
+	return denied
 }
 
+// redactSecrets runs every Secret's Data, Annotations and StringData through
+// the redactor registry, mutating those maps in place - callers must pass
+// DeepCopy'd Secrets, never the informer cache's own objects (see
+// redactConfigMaps). kubectl.kubernetes.io/last-applied-configuration
+// and a dockerconfigjson secret's .dockerconfigjson key are parsed as JSON
+// and redacted recursively rather than regexed as a raw string, since both
+// can carry binary-encoded or nested auth data a plain regex would miss.
 func redactSecrets(secrets []apiv1.Secret) []apiv1.Secret {
+	reg := getRedactor()
+
 	for i, secret := range secrets {
-		// Redact from secret data
 		for key, value := range secret.Data {
-			secret.Data[key] = redactCertificates(value)
+			if key == apiv1.DockerConfigJsonKey {
+				secret.Data[key] = []byte(reg.RedactJSONString(redact.ScopeSecretData, string(value)))
+			} else {
+				secret.Data[key] = []byte(reg.RedactString(redact.ScopeSecretData, string(value)))
+			}
 		}
 
-		// Redact from annotations, including kubectl.kubernetes.io/last-applied-configuration
 		for key, value := range secret.Annotations {
 			if key == "kubectl.kubernetes.io/last-applied-configuration" {
-				// Redact sensitive data within the last-applied-configuration JSON
-				secret.Annotations[key] = string(redactCertificates([]byte(value)))
+				secret.Annotations[key] = reg.RedactJSONString(redact.ScopeSecretAnnotation, value)
 			} else {
-				// Redact certificates from other annotations as well
-				secret.Annotations[key] = string(redactCertificates([]byte(value)))
+				secret.Annotations[key] = reg.RedactString(redact.ScopeSecretAnnotation, value)
 			}
 		}
 
-		// Handle StringData field as well
 		for key, value := range secret.StringData {
-			redactedValue := redactCertificates([]byte(value))
-			secret.StringData[key] = string(redactedValue)
+			secret.StringData[key] = reg.RedactString(redact.ScopeSecretData, value)
 		}
 
-		// Reassign the redacted secret back to the slice
 		secrets[i] = secret
 	}
 	return secrets
 }
 
+// isHelmReleaseSecret reports whether a Secret is one of Helm v3's release
+// storage secrets, which we never show regardless of RBAC.
+func isHelmReleaseSecret(v apiv1.Secret) bool {
+	return strings.HasPrefix(v.ObjectMeta.Name, "sh.helm.release")
+}
+
+// redactConfigMaps runs every ConfigMap's Data/BinaryData through the
+// redactor registry. Like redactSecrets, this mutates the maps in place -
+// callers (sanitizeSnapshot, sanitizeEvent) are responsible for handing it
+// a DeepCopy of whatever the informer cache returned, never the cache's
+// own object, since an in-place write racing another reader of the same
+// cached pointer is a concurrent map write and a process crash.
+func redactConfigMaps(configmaps []apiv1.ConfigMap) {
+	reg := getRedactor()
+	for _, configmap := range configmaps {
+		for key, value := range configmap.Data {
+			configmap.Data[key] = reg.RedactString(redact.ScopeConfigMapData, value)
+		}
+		for key, value := range configmap.BinaryData {
+			configmap.BinaryData[key] = []byte(reg.RedactString(redact.ScopeConfigMapData, string(value)))
+		}
+	}
+}
+
+// sanitizeSnapshot applies the one policy every full-snapshot response
+// (GET /api/scrape and the /api/watch initial frame) must go through
+// before it's marshaled: drop Helm release secrets entirely, then redact
+// whatever's left in Secrets and ConfigMaps.
+func sanitizeSnapshot(snap *scraper.Snapshot) {
+	snap.Secrets = filterSecrets(snap.Secrets, func(v apiv1.Secret) bool { return !isHelmReleaseSecret(v) })
+	snap.Secrets = redactSecrets(snap.Secrets)
+	redactConfigMaps(snap.ConfigMaps)
+}
+
+// sanitizeEvent applies the same policy to a single incremental watch
+// event. It returns ok=false when the event should be dropped outright (a
+// Helm release secret), rather than forwarded with Object still set to the
+// live, unredacted cache object.
+func sanitizeEvent(ev scraper.Event) (out scraper.Event, ok bool) {
+	switch obj := ev.Object.(type) {
+	case *apiv1.Secret:
+		if isHelmReleaseSecret(*obj) {
+			return scraper.Event{}, false
+		}
+		// DeepCopy, not *obj: redactSecrets mutates Data/Annotations/
+		// StringData in place, and obj may still be a pointer shared with
+		// other subscribers of this same event.
+		redacted := redactSecrets([]apiv1.Secret{*obj.DeepCopy()})[0]
+		ev.Object = &redacted
+	case *apiv1.ConfigMap:
+		redacted := *obj.DeepCopy()
+		redactConfigMaps([]apiv1.ConfigMap{redacted})
+		ev.Object = &redacted
+	}
+	return ev, true
+}
+
+// Return the configured redaction rules and how many times each has fired
+// since the process started, so the UI can show what's being hidden.
+func routeRedactors(resp http.ResponseWriter, req *http.Request) {
+	statsJSON, err := json.Marshal(getRedactor().Stats())
+	if err != nil {
+		logError(req.Context(), "failed to marshal redactor stats", err)
+		http.Error(resp, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+	resp.Header().Add("Content-Type", "application/json")
+	if _, err := resp.Write(statsJSON); err != nil {
+		logger.Error("failed to write response body")
+	}
+}
+
 // Simple health check endpoint, returns 204 when healthy
 func routeHealthCheck(resp http.ResponseWriter, req *http.Request) {
 	if healthy {
@@ -152,16 +335,16 @@ func routeStatus(resp http.ResponseWriter, req *http.Request) {
 	resp.Header().Add("Content-Type", "application/json")
 	_, err = resp.Write(statusJSON)
 	if err != nil {
-		log.Println("Unable to write")
+		logger.Error("failed to write response body")
 	}
 }
 
 // Return list of all namespaces in cluster
 func routeGetNamespaces(resp http.ResponseWriter, req *http.Request) {
-	ctx := context.Background()
-	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	ctx := req.Context()
+	namespaces, err := clientFromContext(ctx).CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
 	if err != nil {
-		log.Println("### Kubernetes API error", err.Error())
+		logError(ctx, "kubernetes API error", err)
 		http.Error(resp, err.Error(), http.StatusInternalServerError)
 	}
 	namespacesJSON, _ := json.Marshal(namespaces.Items)
@@ -169,156 +352,187 @@ func routeGetNamespaces(resp http.ResponseWriter, req *http.Request) {
 	resp.Header().Add("Content-Type", "application/json")
 	_, err = resp.Write(namespacesJSON)
 	if err != nil {
-		log.Println("Unable to write")
+		logger.Error("failed to write response body")
 	}
 }
 
-// Return aggregated data from loads of different Kubernetes object types
+// Return aggregated data from loads of different Kubernetes object types.
+// For the server's own client, reads come from the shared informer cache
+// rather than hitting the API server directly, so repeated polling is cheap
+// no matter how many clients are watching. Impersonated per-request clients
+// are served by direct List calls instead (scrapeDirect).
 func routeScrapeData(resp http.ResponseWriter, req *http.Request) {
 	params := mux.Vars(req)
 	namespace := params["ns"]
 
-	ctx := context.Background()
-
-	// Fetch Kubernetes resources
-	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Println("### Kubernetes API error:", err.Error())
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
-		return
+	ctx := req.Context()
+	client := clientFromContext(ctx)
+
+	allowed := checkAccess(ctx, client, namespace)
+
+	// The shared informer cache is built against the server's own
+	// (privileged) clientset. An impersonated per-request client means a
+	// different caller - possibly with different RBAC - so skip the
+	// cache for those and go straight to the API instead.
+	var snap scraper.Snapshot
+	var err error
+	if isPrivilegedClient(client) {
+		snap, err = getScraper().Snapshot(namespace, allowed)
+	} else {
+		snap, err = scrapeDirect(ctx, client, namespace, allowed)
 	}
-
-	services, err := clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		log.Println("### Kubernetes API error:", err.Error())
+		logError(ctx, "kubernetes API error", err)
 		http.Error(resp, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	endpoints, err := clientset.CoreV1().Endpoints(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Println("### Kubernetes API error:", err.Error())
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	sanitizeSnapshot(&snap)
 
-	pvs, err := clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Println("### Kubernetes API error:", err.Error())
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
-		return
+	// Dump of results into the scrapeData struct
+	scrapeResult := scrapeData{
+		Pods:                   snap.Pods,
+		Services:               snap.Services,
+		Endpoints:              snap.Endpoints,
+		PersistentVolumes:      snap.PersistentVolumes,
+		PersistentVolumeClaims: snap.PersistentVolumeClaims,
+		Deployments:            snap.Deployments,
+		DaemonSets:             snap.DaemonSets,
+		ReplicaSets:            snap.ReplicaSets,
+		StatefulSets:           snap.StatefulSets,
+		Ingresses:              snap.Ingresses,
+		ConfigMaps:             snap.ConfigMaps,
+		Secrets:                snap.Secrets,
+		AccessDenied:           deniedKinds(allowed),
 	}
 
-	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	// Marshal the results into JSON
+	scrapeResultJSON, err := json.Marshal(scrapeResult)
 	if err != nil {
-		log.Println("### Kubernetes API error:", err.Error())
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		logError(ctx, "failed to marshal scrape result", err)
+		http.Error(resp, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	configmaps, err := clientset.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Println("### Kubernetes API error:", err.Error())
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
-		return
+	// Set headers and write response
+	resp.Header().Set("Access-Control-Allow-Origin", "*")
+	resp.Header().Add("Content-Type", "application/json")
+	if _, err := resp.Write(scrapeResultJSON); err != nil {
+		logger.Error("failed to write response body")
 	}
+}
 
-	secrets, err := clientset.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Println("### Kubernetes API error:", err.Error())
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
-		return
-	}
+// watchFrame is the envelope sent down the websocket: "snapshot" once at
+// the start, then "event" for every incremental change after that.
+type watchFrame struct {
+	Frame string         `json:"frame"`
+	Data  *scrapeData    `json:"data,omitempty"`
+	Event *scraper.Event `json:"event,omitempty"`
+}
 
-	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Println("### Kubernetes API error:", err.Error())
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
-		return
-	}
+// Upgrade to WebSocket and stream incremental changes for a namespace: an
+// initial snapshot frame equivalent to routeScrapeData's JSON, followed by
+// ADD/UPDATE/DELETE deltas as the informer cache observes them. Slow
+// consumers that can't keep up with their buffered channel are dropped
+// with a 1008 close code rather than backing up the broadcaster.
+func routeWatchData(resp http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	namespace := params["ns"]
 
-	daemonsets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Println("### Kubernetes API error:", err.Error())
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
+	ctx := req.Context()
+	client := clientFromContext(ctx)
+	allowed := checkAccess(ctx, client, namespace)
+
+	// The informer cache streaming below is built and kept warm under the
+	// server's own privileged credentials - there's no per-request watch
+	// yet to serve an impersonated caller's own RBAC-scoped view, so refuse
+	// rather than silently streaming every kind to whoever's impersonated.
+	// Unlike routeScrapeData this can't fall back to scrapeDirect: a direct
+	// List is one-shot, there's nothing to subscribe to for deltas.
+	if !isPrivilegedClient(client) {
+		http.Error(resp, "streaming watch is not available for impersonated callers", http.StatusNotImplemented)
 		return
 	}
 
-	replicasets, err := clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+	conn, err := watchUpgrader.Upgrade(resp, req, nil)
 	if err != nil {
-		log.Println("### Kubernetes API error:", err.Error())
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		logger.Error("failed to upgrade watch connection", "remote_addr", req.RemoteAddr, "error", err.Error())
 		return
 	}
+	defer conn.Close()
 
-	statefulsets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	snap, err := getScraper().Snapshot(namespace, allowed)
 	if err != nil {
-		log.Println("### Kubernetes API error:", err.Error())
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		logError(ctx, "kubernetes API error", err)
+		_ = conn.WriteJSON(watchFrame{Frame: "error"})
 		return
 	}
 
-	ingresses, err := clientset.NetworkingV1().Ingresses(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		log.Println("### Kubernetes API error:", err.Error())
-		http.Error(resp, err.Error(), http.StatusInternalServerError)
+	sanitizeSnapshot(&snap)
+
+	initial := scrapeData{
+		Pods:                   snap.Pods,
+		Services:               snap.Services,
+		Endpoints:              snap.Endpoints,
+		PersistentVolumes:      snap.PersistentVolumes,
+		PersistentVolumeClaims: snap.PersistentVolumeClaims,
+		Deployments:            snap.Deployments,
+		DaemonSets:             snap.DaemonSets,
+		ReplicaSets:            snap.ReplicaSets,
+		StatefulSets:           snap.StatefulSets,
+		Ingresses:              snap.Ingresses,
+		ConfigMaps:             snap.ConfigMaps,
+		Secrets:                snap.Secrets,
+		AccessDenied:           deniedKinds(allowed),
+	}
+	if err := conn.WriteJSON(watchFrame{Frame: "snapshot", Data: &initial}); err != nil {
+		logger.Error("failed to write watch snapshot", "namespace", namespace, "error", err.Error())
 		return
 	}
 
-	// Remove and hide Helm v3 release secrets, we're never going to show them
-	secrets.Items = filterSecrets(secrets.Items, func(v apiv1.Secret) bool {
-		return !strings.HasPrefix(v.ObjectMeta.Name, "sh.helm.release")
-	})
-
-	// Redact sensitive data within secrets, including in kubectl.kubernetes.io/last-applied-configuration
-	secrets.Items = redactSecrets(secrets.Items)
+	sub := getScraper().Subscribe(namespace)
+	defer sub.Unsubscribe()
 
-	// Redact any certificate data from ConfigMaps
-	for _, configmap := range configmaps.Items {
-		for key, value := range configmap.Data {
-			configmap.Data[key] = string(redactCertificates([]byte(value)))
-		}
-
-		for key, value := range configmap.BinaryData {
-			configmap.BinaryData[key] = redactCertificates(value)
+	for {
+		select {
+		case ev, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			// Subscribe fans out every kind regardless of the subscriber's
+			// RBAC, so the same per-kind gate routeScrapeData/Snapshot
+			// apply to the initial frame has to be re-applied per event.
+			if !kindAllowed(allowed, ev.Kind) {
+				continue
+			}
+			sanitized, sendable := sanitizeEvent(ev)
+			if !sendable {
+				continue
+			}
+			if err := conn.WriteJSON(watchFrame{Frame: "event", Event: &sanitized}); err != nil {
+				logger.Error("failed to write watch event", "namespace", namespace, "error", err.Error())
+				return
+			}
+		case <-sub.Dropped():
+			_ = conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(1008, "client too slow, dropped"),
+				time.Now().Add(time.Second),
+			)
+			return
 		}
 	}
-
-	// Dump of results into the scrapeData struct
-	scrapeResult := scrapeData{
-		Pods:                   pods.Items,
-		Services:               services.Items,
-		Endpoints:              endpoints.Items,
-		PersistentVolumes:      pvs.Items,
-		PersistentVolumeClaims: pvcs.Items,
-		Deployments:            deployments.Items,
-		DaemonSets:             daemonsets.Items,
-		ReplicaSets:            replicasets.Items,
-		StatefulSets:           statefulsets.Items,
-		Ingresses:              ingresses.Items,
-		ConfigMaps:             configmaps.Items,
-		Secrets:                secrets.Items,
-	}
-
-	// Marshal the results into JSON
-	scrapeResultJSON, err := json.Marshal(scrapeResult)
-	if err != nil {
-		log.Println("### Failed to marshal scrape result: ", err)
-		http.Error(resp, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	// Set headers and write response
-	resp.Header().Set("Access-Control-Allow-Origin", "*")
-	resp.Header().Add("Content-Type", "application/json")
-	if _, err := resp.Write(scrapeResultJSON); err != nil {
-		log.Println("Unable to write")
-	}
 }
 
 // Simple config endpoint, returns NAMESPACE_SCOPE var to front end
 func routeConfig(resp http.ResponseWriter, req *http.Request) {
-	nsScope := env.GetEnvString("NAMESPACE_SCOPE", "*")
+	nsScope := env.GetEnvString("NAMESPACE_SCOPE", "")
+	if nsScope == "" {
+		// Not configured explicitly: fall back to whatever namespace
+		// we're running in, if we can tell (e.g. deployed in-cluster
+		// under a namespaced service account), else scrape everything.
+		nsScope = discoverNamespaceScope()
+	}
 	conf := Config{NamespaceScope: nsScope}
 
 	configJSON, _ := json.Marshal(conf)
@@ -326,7 +540,7 @@ func routeConfig(resp http.ResponseWriter, req *http.Request) {
 	resp.Header().Add("Content-Type", "application/json")
 	_, err := resp.Write([]byte(configJSON))
 	if err != nil {
-		log.Println("Unable to write")
+		logger.Error("failed to write response body")
 	}
 }
 
@@ -0,0 +1,157 @@
+// Default package
+package main
+
+//
+// Direct (non-cached) scraping, used for per-request impersonated clients.
+// The shared informer cache in pkg/scraper is built against one
+// (privileged) clientset; serving an impersonated caller from it would
+// mean everyone sees data cached under the server's own credentials
+// rather than their own. So when a request carries its own client we fall
+// back to the original sequential List calls instead, gated by the same
+// per-kind access map routeScrapeData already computed.
+//
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ECPaaS/cloudview-kubeview/pkg/scraper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// scrapeDirect lists every kind in allowed (or everything, if allowed is
+// nil) directly from the API server using client, and assembles the
+// result into the same Snapshot shape the informer cache produces.
+func scrapeDirect(ctx context.Context, client kubernetes.Interface, namespace string, allowed map[string]bool) (scraper.Snapshot, error) {
+	var snap scraper.Snapshot
+
+	if kindAllowed(allowed, "Pod") {
+		start := time.Now()
+		v, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		observeScrape(namespace, "Pod", start, err)
+		if err != nil {
+			return scraper.Snapshot{}, fmt.Errorf("listing pods: %w", err)
+		}
+		snap.Pods = v.Items
+	}
+
+	if kindAllowed(allowed, "Service") {
+		start := time.Now()
+		v, err := client.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+		observeScrape(namespace, "Service", start, err)
+		if err != nil {
+			return scraper.Snapshot{}, fmt.Errorf("listing services: %w", err)
+		}
+		snap.Services = v.Items
+	}
+
+	if kindAllowed(allowed, "Endpoints") {
+		start := time.Now()
+		v, err := client.CoreV1().Endpoints(namespace).List(ctx, metav1.ListOptions{})
+		observeScrape(namespace, "Endpoints", start, err)
+		if err != nil {
+			return scraper.Snapshot{}, fmt.Errorf("listing endpoints: %w", err)
+		}
+		snap.Endpoints = v.Items
+	}
+
+	if kindAllowed(allowed, "PersistentVolume") {
+		start := time.Now()
+		v, err := client.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+		observeScrape(namespace, "PersistentVolume", start, err)
+		if err != nil {
+			return scraper.Snapshot{}, fmt.Errorf("listing persistentvolumes: %w", err)
+		}
+		snap.PersistentVolumes = v.Items
+	}
+
+	if kindAllowed(allowed, "PersistentVolumeClaim") {
+		start := time.Now()
+		v, err := client.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+		observeScrape(namespace, "PersistentVolumeClaim", start, err)
+		if err != nil {
+			return scraper.Snapshot{}, fmt.Errorf("listing persistentvolumeclaims: %w", err)
+		}
+		snap.PersistentVolumeClaims = v.Items
+	}
+
+	if kindAllowed(allowed, "ConfigMap") {
+		start := time.Now()
+		v, err := client.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
+		observeScrape(namespace, "ConfigMap", start, err)
+		if err != nil {
+			return scraper.Snapshot{}, fmt.Errorf("listing configmaps: %w", err)
+		}
+		snap.ConfigMaps = v.Items
+	}
+
+	if kindAllowed(allowed, "Secret") {
+		start := time.Now()
+		v, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
+		observeScrape(namespace, "Secret", start, err)
+		if err != nil {
+			return scraper.Snapshot{}, fmt.Errorf("listing secrets: %w", err)
+		}
+		snap.Secrets = v.Items
+	}
+
+	if kindAllowed(allowed, "Deployment") {
+		start := time.Now()
+		v, err := client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+		observeScrape(namespace, "Deployment", start, err)
+		if err != nil {
+			return scraper.Snapshot{}, fmt.Errorf("listing deployments: %w", err)
+		}
+		snap.Deployments = v.Items
+	}
+
+	if kindAllowed(allowed, "DaemonSet") {
+		start := time.Now()
+		v, err := client.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+		observeScrape(namespace, "DaemonSet", start, err)
+		if err != nil {
+			return scraper.Snapshot{}, fmt.Errorf("listing daemonsets: %w", err)
+		}
+		snap.DaemonSets = v.Items
+	}
+
+	if kindAllowed(allowed, "ReplicaSet") {
+		start := time.Now()
+		v, err := client.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+		observeScrape(namespace, "ReplicaSet", start, err)
+		if err != nil {
+			return scraper.Snapshot{}, fmt.Errorf("listing replicasets: %w", err)
+		}
+		snap.ReplicaSets = v.Items
+	}
+
+	if kindAllowed(allowed, "StatefulSet") {
+		start := time.Now()
+		v, err := client.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+		observeScrape(namespace, "StatefulSet", start, err)
+		if err != nil {
+			return scraper.Snapshot{}, fmt.Errorf("listing statefulsets: %w", err)
+		}
+		snap.StatefulSets = v.Items
+	}
+
+	if kindAllowed(allowed, "Ingress") {
+		start := time.Now()
+		v, err := client.NetworkingV1().Ingresses(namespace).List(ctx, metav1.ListOptions{})
+		observeScrape(namespace, "Ingress", start, err)
+		if err != nil {
+			return scraper.Snapshot{}, fmt.Errorf("listing ingresses: %w", err)
+		}
+		snap.Ingresses = v.Items
+	}
+
+	return snap, nil
+}
+
+// kindAllowed mirrors the scraper package's own helper: nil means no
+// access review was done and everything is allowed.
+func kindAllowed(allowed map[string]bool, kind string) bool {
+	return allowed == nil || allowed[kind]
+}
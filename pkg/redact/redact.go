@@ -0,0 +1,299 @@
+// Package redact implements a pluggable registry of redaction rules used to
+// scrub sensitive data (certificates, private keys, tokens, credentials)
+// out of scraped Kubernetes objects before they're sent to the browser.
+// Built-in rules cover the common cases; operators can add more via a
+// YAML or JSON file pointed to by the REDACTION_CONFIG env var.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scope limits where a rule is applied. ScopeAnyString rules run
+// everywhere, regardless of the scope being redacted.
+type Scope string
+
+// Supported scopes.
+const (
+	ScopeSecretData       Scope = "secret-data"
+	ScopeSecretAnnotation Scope = "secret-annotation"
+	ScopeConfigMapData    Scope = "configmap-data"
+	ScopeAnyString        Scope = "any-string"
+)
+
+// Rule is a single redaction rule: either a compiled regexp applied to any
+// string value in scope, or a JSONPath-ish dotted path (supporting a `*`
+// wildcard for map keys) applied to a decoded JSON structure, e.g.
+// ".auths.*.auth" for a dockerconfigjson secret.
+type Rule struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	JSONPath    string
+	Replacement string
+	Scope       Scope
+}
+
+// ruleConfig is the on-disk shape of a rule in REDACTION_CONFIG.
+type ruleConfig struct {
+	Name        string `yaml:"name" json:"name"`
+	Pattern     string `yaml:"pattern" json:"pattern"`
+	JSONPath    string `yaml:"jsonPath" json:"jsonPath"`
+	Replacement string `yaml:"replacement" json:"replacement"`
+	Scope       string `yaml:"scope" json:"scope"`
+}
+
+type fileConfig struct {
+	Rules []ruleConfig `yaml:"rules" json:"rules"`
+}
+
+// RuleStat is what GET /api/redactors reports: the rule's identity plus
+// how many times it's fired since the process started.
+type RuleStat struct {
+	Name  string `json:"name"`
+	Scope Scope  `json:"scope"`
+	Fired uint64 `json:"fired"`
+}
+
+// Registry holds the active set of rules and a firing counter per rule,
+// which also backs the kubeview_redactions_total metric.
+type Registry struct {
+	mu     sync.Mutex
+	rules  []Rule
+	fired  map[string]uint64
+	onFire func(rule string)
+}
+
+// NewRegistry returns a Registry seeded with the built-in rules.
+func NewRegistry() *Registry {
+	return &Registry{
+		rules: builtinRules(),
+		fired: make(map[string]uint64),
+	}
+}
+
+// LoadFromEnv builds a Registry from the built-ins plus, if REDACTION_CONFIG
+// is set, any additional rules found there. A bad config file is logged by
+// the caller via the returned error and otherwise ignored - built-ins still
+// apply.
+func LoadFromEnv() (*Registry, error) {
+	reg := NewRegistry()
+
+	path := os.Getenv("REDACTION_CONFIG")
+	if path == "" {
+		return reg, nil
+	}
+
+	if err := reg.loadFile(path); err != nil {
+		return reg, fmt.Errorf("loading REDACTION_CONFIG %s: %w", path, err)
+	}
+	return reg, nil
+}
+
+func (r *Registry) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var cfg fileConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("parsing rules: %w", err)
+	}
+
+	rules := make([]Rule, 0, len(cfg.Rules))
+	for _, rc := range cfg.Rules {
+		rule := Rule{
+			Name:        rc.Name,
+			JSONPath:    rc.JSONPath,
+			Replacement: rc.Replacement,
+			Scope:       Scope(rc.Scope),
+		}
+		if rc.Pattern != "" {
+			re, err := regexp.Compile(rc.Pattern)
+			if err != nil {
+				return fmt.Errorf("rule %q: compiling pattern: %w", rc.Name, err)
+			}
+			rule.Pattern = re
+		}
+		rules = append(rules, rule)
+	}
+	r.rules = append(r.rules, rules...)
+	return nil
+}
+
+// OnFire registers a callback invoked (with the rule name) every time a
+// rule redacts something. Used to wire up the redactions-by-rule metric
+// without this package knowing anything about Prometheus.
+func (r *Registry) OnFire(f func(rule string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onFire = f
+}
+
+func (r *Registry) fire(name string) {
+	r.mu.Lock()
+	r.fired[name]++
+	cb := r.onFire
+	r.mu.Unlock()
+	if cb != nil {
+		cb(name)
+	}
+}
+
+// Stats returns the fire count for every configured rule, for GET /api/redactors.
+func (r *Registry) Stats() []RuleStat {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]RuleStat, 0, len(r.rules))
+	for _, rule := range r.rules {
+		stats = append(stats, RuleStat{Name: rule.Name, Scope: rule.Scope, Fired: r.fired[rule.Name]})
+	}
+	return stats
+}
+
+// RedactString applies every pattern-based rule whose scope matches (or is
+// ScopeAnyString) to s, returning the redacted result.
+func (r *Registry) RedactString(scope Scope, s string) string {
+	for _, rule := range r.rules {
+		if rule.Pattern == nil {
+			continue
+		}
+		if rule.Scope != scope && rule.Scope != ScopeAnyString {
+			continue
+		}
+		if rule.Pattern.MatchString(s) {
+			s = rule.Pattern.ReplaceAllString(s, rule.Replacement)
+			r.fire(rule.Name)
+		}
+	}
+	return s
+}
+
+// RedactJSONString parses s as JSON, applies every JSONPath rule in scope
+// followed by the regular pattern rules over every string leaf, and
+// re-marshals it. Used for things like the
+// kubectl.kubernetes.io/last-applied-configuration annotation, which is
+// JSON smuggled inside a string and shouldn't just be regexed as-is. If s
+// doesn't parse as JSON it falls back to RedactString.
+func (r *Registry) RedactJSONString(scope Scope, s string) string {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(s), &parsed); err != nil {
+		return r.RedactString(scope, s)
+	}
+
+	redacted := r.redactJSON(scope, parsed)
+
+	out, err := json.Marshal(redacted)
+	if err != nil {
+		return r.RedactString(scope, s)
+	}
+	return string(out)
+}
+
+func (r *Registry) redactJSON(scope Scope, data interface{}) interface{} {
+	for _, rule := range r.rules {
+		if rule.JSONPath == "" || (rule.Scope != scope && rule.Scope != ScopeAnyString) {
+			continue
+		}
+		data = r.applyJSONPath(rule, data)
+	}
+
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = r.redactJSON(scope, val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = r.redactJSON(scope, val)
+		}
+		return v
+	case string:
+		return r.RedactString(scope, v)
+	default:
+		return data
+	}
+}
+
+// applyJSONPath walks a dotted path like ".auths.*.auth" (a leading "." is
+// optional) through data, replacing every string value it reaches with
+// rule.Replacement. "*" matches every key of a map at that level.
+func (r *Registry) applyJSONPath(rule Rule, data interface{}) interface{} {
+	segments := strings.Split(strings.TrimPrefix(rule.JSONPath, "."), ".")
+	return r.walkPath(rule, data, segments)
+}
+
+func (r *Registry) walkPath(rule Rule, node interface{}, segments []string) interface{} {
+	if len(segments) == 0 {
+		if _, ok := node.(string); ok {
+			r.fire(rule.Name)
+			return rule.Replacement
+		}
+		return node
+	}
+
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return node
+	}
+
+	seg := segments[0]
+	if seg == "*" {
+		for key, val := range m {
+			m[key] = r.walkPath(rule, val, segments[1:])
+		}
+		return m
+	}
+
+	if val, ok := m[seg]; ok {
+		m[seg] = r.walkPath(rule, val, segments[1:])
+	}
+	return m
+}
+
+// builtinRules ships the default coverage: PEM certificates and private
+// keys, JWT-looking strings, AWS access keys, and the auth field buried in
+// a dockerconfigjson secret.
+func builtinRules() []Rule {
+	return []Rule{
+		{
+			Name:        "pem-certificate",
+			Scope:       ScopeAnyString,
+			Pattern:     regexp.MustCompile(`(?i)-----+BEGIN\s+CERTIFICATE-----+[^\-]+-----+END\s+CERTIFICATE-----+`),
+			Replacement: "__CERTIFICATE REDACTED__",
+		},
+		{
+			Name:        "pem-private-key",
+			Scope:       ScopeAnyString,
+			Pattern:     regexp.MustCompile(`(?i)-----+BEGIN\s+(RSA |EC |OPENSSH )?PRIVATE KEY-----+[^\-]+-----+END\s+(RSA |EC |OPENSSH )?PRIVATE KEY-----+`),
+			Replacement: "__PRIVATE KEY REDACTED__",
+		},
+		{
+			Name:        "jwt",
+			Scope:       ScopeAnyString,
+			Pattern:     regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+			Replacement: "__JWT REDACTED__",
+		},
+		{
+			Name:        "aws-access-key",
+			Scope:       ScopeAnyString,
+			Pattern:     regexp.MustCompile(`AKIA[0-9A-Z]{16}`),
+			Replacement: "__AWS ACCESS KEY REDACTED__",
+		},
+		{
+			Name:        "dockerconfigjson-auth",
+			Scope:       ScopeSecretData,
+			JSONPath:    ".auths.*.auth",
+			Replacement: "__DOCKER AUTH REDACTED__",
+		},
+	}
+}
@@ -0,0 +1,514 @@
+// Package scraper maintains a shared-informer-backed cache of Kubernetes
+// resources, one SharedInformerFactory per namespace that's actually being
+// viewed. It replaces the old pattern of firing off a dozen sequential
+// List calls on every poll: the cache is populated once by watch and kept
+// in sync in the background, so snapshot reads are instant and changes can
+// be fanned out to subscribers as they happen.
+package scraper
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// resyncPeriod is how often each informer does a full relist, on top of
+// watching for incremental changes in between.
+const resyncPeriod = 10 * time.Minute
+
+// clientBufferSize is how many pending events we'll queue for a single
+// subscriber before we treat it as a slow consumer and drop it.
+const clientBufferSize = 256
+
+// EventType mirrors the add/update/delete callbacks informers hand us.
+type EventType string
+
+// Event types pushed to subscribers.
+const (
+	EventAdd    EventType = "ADD"
+	EventUpdate EventType = "UPDATE"
+	EventDelete EventType = "DELETE"
+)
+
+// Event is a single incremental change, keyed the same way the frontend
+// already keys objects: kind/namespace/name.
+type Event struct {
+	Type      EventType   `json:"type"`
+	Kind      string      `json:"kind"`
+	Namespace string      `json:"namespace"`
+	Name      string      `json:"name"`
+	Object    interface{} `json:"object,omitempty"`
+}
+
+// Snapshot is the same shape scrapeData has always produced, so the first
+// frame a watch client receives looks identical to today's /api/scrape
+// response.
+type Snapshot struct {
+	Pods                   []apiv1.Pod                   `json:"pods"`
+	Services               []apiv1.Service               `json:"services"`
+	Endpoints              []apiv1.Endpoints             `json:"endpoints"`
+	PersistentVolumes      []apiv1.PersistentVolume      `json:"persistentvolumes"`
+	PersistentVolumeClaims []apiv1.PersistentVolumeClaim `json:"persistentvolumeclaims"`
+	Deployments            []appsv1.Deployment           `json:"deployments"`
+	DaemonSets             []appsv1.DaemonSet            `json:"daemonsets"`
+	ReplicaSets            []appsv1.ReplicaSet           `json:"replicasets"`
+	StatefulSets           []appsv1.StatefulSet          `json:"statefulsets"`
+	Ingresses              []networkingv1.Ingress        `json:"ingresses"`
+	ConfigMaps             []apiv1.ConfigMap             `json:"configmaps"`
+	Secrets                []apiv1.Secret                `json:"secrets"`
+}
+
+// Subscriber is a single watching HTTP client for one namespace. Events is
+// never closed: a subscriber too slow to keep up is removed and has its
+// Dropped channel closed, and Unsubscribe only removes it from the
+// namespace's subscriber set.
+type Subscriber struct {
+	Events chan Event
+
+	namespace string
+	scraper   *Scraper
+	closeOnce sync.Once
+	dropped   chan struct{}
+}
+
+// Dropped is closed when the scraper itself gave up on this subscriber for
+// being too slow to drain its channel. Watch handlers should select on this
+// alongside normal reads from Events so they can close with 1008.
+func (s *Subscriber) Dropped() <-chan struct{} {
+	return s.dropped
+}
+
+// Unsubscribe removes the subscriber from its namespace cache. Safe to call
+// more than once.
+func (s *Subscriber) Unsubscribe() {
+	s.scraper.unsubscribe(s.namespace, s)
+}
+
+// namespaceCache holds the informer factory and live subscriber set for one
+// watched namespace.
+type namespaceCache struct {
+	factory informers.SharedInformerFactory
+	stopCh  chan struct{}
+
+	mu          sync.Mutex
+	subscribers map[*Subscriber]struct{}
+	started     map[string]bool
+}
+
+// kindSpec describes one of the resource kinds we watch: its name (matching
+// the Kind set by toEvent, and the key used in the allowed map passed to
+// Snapshot) and how to get its informer out of a factory.
+type kindSpec struct {
+	name     string
+	informer func(informers.SharedInformerFactory) cache.SharedIndexInformer
+}
+
+var kindSpecs = []kindSpec{
+	{"Pod", func(f informers.SharedInformerFactory) cache.SharedIndexInformer { return f.Core().V1().Pods().Informer() }},
+	{"Service", func(f informers.SharedInformerFactory) cache.SharedIndexInformer { return f.Core().V1().Services().Informer() }},
+	{"Endpoints", func(f informers.SharedInformerFactory) cache.SharedIndexInformer { return f.Core().V1().Endpoints().Informer() }},
+	{"PersistentVolume", func(f informers.SharedInformerFactory) cache.SharedIndexInformer { return f.Core().V1().PersistentVolumes().Informer() }},
+	{"PersistentVolumeClaim", func(f informers.SharedInformerFactory) cache.SharedIndexInformer { return f.Core().V1().PersistentVolumeClaims().Informer() }},
+	{"ConfigMap", func(f informers.SharedInformerFactory) cache.SharedIndexInformer { return f.Core().V1().ConfigMaps().Informer() }},
+	{"Secret", func(f informers.SharedInformerFactory) cache.SharedIndexInformer { return f.Core().V1().Secrets().Informer() }},
+	{"Deployment", func(f informers.SharedInformerFactory) cache.SharedIndexInformer { return f.Apps().V1().Deployments().Informer() }},
+	{"DaemonSet", func(f informers.SharedInformerFactory) cache.SharedIndexInformer { return f.Apps().V1().DaemonSets().Informer() }},
+	{"ReplicaSet", func(f informers.SharedInformerFactory) cache.SharedIndexInformer { return f.Apps().V1().ReplicaSets().Informer() }},
+	{"StatefulSet", func(f informers.SharedInformerFactory) cache.SharedIndexInformer { return f.Apps().V1().StatefulSets().Informer() }},
+	{"Ingress", func(f informers.SharedInformerFactory) cache.SharedIndexInformer { return f.Networking().V1().Ingresses().Informer() }},
+}
+
+// kindAllowed reports whether kind may be scraped. A nil allowed map means
+// no access review was done (e.g. the caller already knows it's privileged)
+// and everything is allowed, matching the old all-or-nothing behaviour.
+func kindAllowed(allowed map[string]bool, kind string) bool {
+	return allowed == nil || allowed[kind]
+}
+
+// Scraper is a shared-informer-backed cache of Kubernetes resources.
+// Informers are started lazily, the first time a namespace is requested,
+// and kept running for the lifetime of the process.
+type Scraper struct {
+	clientset kubernetes.Interface
+
+	mu          sync.Mutex
+	caches      map[string]*namespaceCache
+	metricsHook MetricsHook
+}
+
+// MetricsHook is called after every per-kind cache read Snapshot does, so
+// callers can wire it up to e.g. a Prometheus histogram/counter pair
+// without this package knowing anything about Prometheus.
+type MetricsHook func(namespace, kind string, duration time.Duration, err error)
+
+// SetMetricsHook installs hook, replacing any previous one.
+func (s *Scraper) SetMetricsHook(hook MetricsHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metricsHook = hook
+}
+
+func (s *Scraper) observe(namespace, kind string, start time.Time, err error) {
+	s.mu.Lock()
+	hook := s.metricsHook
+	s.mu.Unlock()
+	if hook != nil {
+		hook(namespace, kind, time.Since(start), err)
+	}
+}
+
+// New creates a Scraper. Call Snapshot or Subscribe to start watching a
+// namespace; nothing talks to the API server until then.
+func New(clientset kubernetes.Interface) *Scraper {
+	return &Scraper{
+		clientset: clientset,
+		caches:    make(map[string]*namespaceCache),
+	}
+}
+
+// ensure returns the namespaceCache for ns, creating it if this is the
+// first time ns has been requested, then starts informers for any kind in
+// allowed that isn't already running. A nil allowed map starts every kind
+// (the original all-or-nothing behaviour). Subscribe passes nil, so a
+// subscription starts every kind whatever access review its caller ran.
+func (s *Scraper) ensure(ns string, allowed map[string]bool) *namespaceCache {
+	s.mu.Lock()
+	nc, ok := s.caches[ns]
+	if !ok {
+		factory := informers.NewSharedInformerFactoryWithOptions(s.clientset, resyncPeriod, informers.WithNamespace(ns))
+		nc = &namespaceCache{
+			factory:     factory,
+			stopCh:      make(chan struct{}),
+			subscribers: make(map[*Subscriber]struct{}),
+			started:     make(map[string]bool),
+		}
+		s.caches[ns] = nc
+	}
+	s.mu.Unlock()
+
+	nc.startKinds(allowed)
+	return nc
+}
+
+// startKinds registers and starts the informer for every kind in allowed
+// that isn't running yet, then waits for just those new informers to sync.
+// Kinds the caller can't list are simply never started, so a forbidden
+// resource type degrades to "empty" instead of the reflector spinning on
+// repeated 403s.
+func (nc *namespaceCache) startKinds(allowed map[string]bool) {
+	nc.mu.Lock()
+	var started bool
+	for _, spec := range kindSpecs {
+		if !kindAllowed(allowed, spec.name) || nc.started[spec.name] {
+			continue
+		}
+		inf := spec.informer(nc.factory)
+		inf.AddEventHandler(nc.handlerFor(inf))
+		nc.started[spec.name] = true
+		started = true
+	}
+	nc.mu.Unlock()
+
+	if !started {
+		return
+	}
+	nc.factory.Start(nc.stopCh)
+	nc.factory.WaitForCacheSync(nc.stopCh)
+}
+
+// handlerFor builds a ResourceEventHandlerFuncs that resolves the kind of
+// the informed-on object and fans the resulting Event out to subscribers.
+func (nc *namespaceCache) handlerFor(inf cache.SharedIndexInformer) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { nc.broadcast(EventAdd, obj) },
+		UpdateFunc: func(_, obj interface{}) { nc.broadcast(EventUpdate, obj) },
+		DeleteFunc: func(obj interface{}) {
+			if tomb, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tomb.Obj
+			}
+			nc.broadcast(EventDelete, obj)
+		},
+	}
+}
+
+// broadcast delivers ev to every subscriber, dropping any that can't keep
+// up with a 1008 close rather than blocking the informer's event loop.
+func (nc *namespaceCache) broadcast(t EventType, obj interface{}) {
+	ev, ok := toEvent(t, obj)
+	if !ok {
+		return
+	}
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	for sub := range nc.subscribers {
+		select {
+		case sub.Events <- ev:
+		default:
+			delete(nc.subscribers, sub)
+			close(sub.dropped)
+		}
+	}
+}
+
+// Snapshot returns the current cached state of ns, equivalent to what
+// routeScrapeData used to build from twelve sequential List calls. allowed
+// gates which kinds are read from the cache at all; a nil map reads
+// everything, matching the original all-or-nothing behaviour. Kinds the
+// caller isn't allowed to list come back as a nil/empty slice rather than
+// an error, so a forbidden resource type degrades gracefully instead of
+// failing the whole snapshot.
+func (s *Scraper) Snapshot(ns string, allowed map[string]bool) (Snapshot, error) {
+	nc := s.ensure(ns, allowed)
+	f := nc.factory
+	sel := labels.Everything()
+	snap := Snapshot{}
+
+	if kindAllowed(allowed, "Pod") {
+		start := time.Now()
+		pods, err := f.Core().V1().Pods().Lister().Pods(ns).List(sel)
+		s.observe(ns, "Pod", start, err)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("listing pods from cache: %w", err)
+		}
+		for _, v := range pods {
+			snap.Pods = append(snap.Pods, *v)
+		}
+	}
+
+	if kindAllowed(allowed, "Service") {
+		start := time.Now()
+		services, err := f.Core().V1().Services().Lister().Services(ns).List(sel)
+		s.observe(ns, "Service", start, err)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("listing services from cache: %w", err)
+		}
+		for _, v := range services {
+			snap.Services = append(snap.Services, *v)
+		}
+	}
+
+	if kindAllowed(allowed, "Endpoints") {
+		start := time.Now()
+		endpoints, err := f.Core().V1().Endpoints().Lister().Endpoints(ns).List(sel)
+		s.observe(ns, "Endpoints", start, err)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("listing endpoints from cache: %w", err)
+		}
+		for _, v := range endpoints {
+			snap.Endpoints = append(snap.Endpoints, *v)
+		}
+	}
+
+	if kindAllowed(allowed, "PersistentVolume") {
+		start := time.Now()
+		pvs, err := f.Core().V1().PersistentVolumes().Lister().List(sel)
+		s.observe(ns, "PersistentVolume", start, err)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("listing persistentvolumes from cache: %w", err)
+		}
+		snap.PersistentVolumes = toSlice(pvs)
+	}
+
+	if kindAllowed(allowed, "PersistentVolumeClaim") {
+		start := time.Now()
+		pvcs, err := f.Core().V1().PersistentVolumeClaims().Lister().PersistentVolumeClaims(ns).List(sel)
+		s.observe(ns, "PersistentVolumeClaim", start, err)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("listing persistentvolumeclaims from cache: %w", err)
+		}
+		for _, v := range pvcs {
+			snap.PersistentVolumeClaims = append(snap.PersistentVolumeClaims, *v)
+		}
+	}
+
+	if kindAllowed(allowed, "ConfigMap") {
+		start := time.Now()
+		configmaps, err := f.Core().V1().ConfigMaps().Lister().ConfigMaps(ns).List(sel)
+		s.observe(ns, "ConfigMap", start, err)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("listing configmaps from cache: %w", err)
+		}
+		for _, v := range configmaps {
+			// DeepCopy, not *v: v is the literal pointer stored in the
+			// informer's store, and routes.go redacts ConfigMaps in place -
+			// writing through it would race every other reader of the cache
+			// and corrupt the store's own copy.
+			snap.ConfigMaps = append(snap.ConfigMaps, *v.DeepCopy())
+		}
+	}
+
+	if kindAllowed(allowed, "Secret") {
+		start := time.Now()
+		secrets, err := f.Core().V1().Secrets().Lister().Secrets(ns).List(sel)
+		s.observe(ns, "Secret", start, err)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("listing secrets from cache: %w", err)
+		}
+		for _, v := range secrets {
+			// Same reasoning as ConfigMaps above: redactSecrets mutates
+			// Data/Annotations/StringData in place, so this must not be the
+			// cache's own Secret.
+			snap.Secrets = append(snap.Secrets, *v.DeepCopy())
+		}
+	}
+
+	if kindAllowed(allowed, "Deployment") {
+		start := time.Now()
+		deployments, err := f.Apps().V1().Deployments().Lister().Deployments(ns).List(sel)
+		s.observe(ns, "Deployment", start, err)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("listing deployments from cache: %w", err)
+		}
+		for _, v := range deployments {
+			snap.Deployments = append(snap.Deployments, *v)
+		}
+	}
+
+	if kindAllowed(allowed, "DaemonSet") {
+		start := time.Now()
+		daemonsets, err := f.Apps().V1().DaemonSets().Lister().DaemonSets(ns).List(sel)
+		s.observe(ns, "DaemonSet", start, err)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("listing daemonsets from cache: %w", err)
+		}
+		for _, v := range daemonsets {
+			snap.DaemonSets = append(snap.DaemonSets, *v)
+		}
+	}
+
+	if kindAllowed(allowed, "ReplicaSet") {
+		start := time.Now()
+		replicasets, err := f.Apps().V1().ReplicaSets().Lister().ReplicaSets(ns).List(sel)
+		s.observe(ns, "ReplicaSet", start, err)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("listing replicasets from cache: %w", err)
+		}
+		for _, v := range replicasets {
+			snap.ReplicaSets = append(snap.ReplicaSets, *v)
+		}
+	}
+
+	if kindAllowed(allowed, "StatefulSet") {
+		start := time.Now()
+		statefulsets, err := f.Apps().V1().StatefulSets().Lister().StatefulSets(ns).List(sel)
+		s.observe(ns, "StatefulSet", start, err)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("listing statefulsets from cache: %w", err)
+		}
+		for _, v := range statefulsets {
+			snap.StatefulSets = append(snap.StatefulSets, *v)
+		}
+	}
+
+	if kindAllowed(allowed, "Ingress") {
+		start := time.Now()
+		ingresses, err := f.Networking().V1().Ingresses().Lister().Ingresses(ns).List(sel)
+		s.observe(ns, "Ingress", start, err)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("listing ingresses from cache: %w", err)
+		}
+		for _, v := range ingresses {
+			snap.Ingresses = append(snap.Ingresses, *v)
+		}
+	}
+
+	return snap, nil
+}
+
+// toSlice dereferences a lister's slice of pointers into a slice of values,
+// matching the []T shape the JSON API has always returned.
+func toSlice(pvs []*apiv1.PersistentVolume) []apiv1.PersistentVolume {
+	out := make([]apiv1.PersistentVolume, 0, len(pvs))
+	for _, pv := range pvs {
+		out = append(out, *pv)
+	}
+	return out
+}
+
+// Subscribe registers a new subscriber for ns and returns it. The caller is
+// responsible for calling Unsubscribe once it's done reading.
+func (s *Scraper) Subscribe(ns string) *Subscriber {
+	nc := s.ensure(ns, nil)
+
+	sub := &Subscriber{
+		Events:    make(chan Event, clientBufferSize),
+		namespace: ns,
+		scraper:   s,
+		dropped:   make(chan struct{}),
+	}
+
+	nc.mu.Lock()
+	nc.subscribers[sub] = struct{}{}
+	nc.mu.Unlock()
+
+	return sub
+}
+
+func (s *Scraper) unsubscribe(ns string, sub *Subscriber) {
+	s.mu.Lock()
+	nc, ok := s.caches[ns]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if _, ok := nc.subscribers[sub]; ok {
+		delete(nc.subscribers, sub)
+		sub.closeOnce.Do(func() {})
+	}
+}
+
+// toEvent resolves the kind of obj and builds the Event to fan out. Objects
+// we don't recognise (there shouldn't be any, given the fixed set of
+// informers we register) are silently dropped.
+func toEvent(t EventType, obj interface{}) (Event, bool) {
+	ev := Event{Type: t, Object: obj}
+
+	switch o := obj.(type) {
+	case *apiv1.Pod:
+		ev.Kind, ev.Namespace, ev.Name = "Pod", o.Namespace, o.Name
+	case *apiv1.Service:
+		ev.Kind, ev.Namespace, ev.Name = "Service", o.Namespace, o.Name
+	case *apiv1.Endpoints:
+		ev.Kind, ev.Namespace, ev.Name = "Endpoints", o.Namespace, o.Name
+	case *apiv1.PersistentVolume:
+		ev.Kind, ev.Namespace, ev.Name = "PersistentVolume", o.Namespace, o.Name
+	case *apiv1.PersistentVolumeClaim:
+		ev.Kind, ev.Namespace, ev.Name = "PersistentVolumeClaim", o.Namespace, o.Name
+	case *apiv1.ConfigMap:
+		// DeepCopy: o is the literal pointer in the informer's store, and
+		// sanitizeEvent redacts ConfigMaps in place before sending.
+		ev.Object = o.DeepCopy()
+		ev.Kind, ev.Namespace, ev.Name = "ConfigMap", o.Namespace, o.Name
+	case *apiv1.Secret:
+		// Same reasoning as ConfigMap above: sanitizeEvent's Secret
+		// redaction must never write through the cache's own object.
+		ev.Object = o.DeepCopy()
+		ev.Kind, ev.Namespace, ev.Name = "Secret", o.Namespace, o.Name
+	case *appsv1.Deployment:
+		ev.Kind, ev.Namespace, ev.Name = "Deployment", o.Namespace, o.Name
+	case *appsv1.DaemonSet:
+		ev.Kind, ev.Namespace, ev.Name = "DaemonSet", o.Namespace, o.Name
+	case *appsv1.ReplicaSet:
+		ev.Kind, ev.Namespace, ev.Name = "ReplicaSet", o.Namespace, o.Name
+	case *appsv1.StatefulSet:
+		ev.Kind, ev.Namespace, ev.Name = "StatefulSet", o.Namespace, o.Name
+	case *networkingv1.Ingress:
+		ev.Kind, ev.Namespace, ev.Name = "Ingress", o.Namespace, o.Name
+	default:
+		return Event{}, false
+	}
+
+	return ev, true
+}